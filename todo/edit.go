@@ -0,0 +1,285 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.google.com/p/eaburns.todo/todotxt"
+)
+
+// An opKind names the kind of mutation an Op recorded.
+type opKind string
+
+const (
+	opDone     opKind = "done"
+	opReopen   opKind = "reopen"
+	opPriority opKind = "priority"
+
+	// opUndoMark and opRedoMark are written to the journal by Undo and
+	// Redo to record a position change rather than a new edit, so that
+	// replaying the journal on restart reconstructs the undo position
+	// along with the edits themselves.
+	opUndoMark opKind = "undo"
+	opRedoMark opKind = "redo"
+)
+
+// An Op is a single reversible edit to one task, as recorded in a
+// History.  Before and After are the task's full todo.txt line before
+// and after the edit; AddedID and AddedText describe a follow-up task
+// created as a side effect (currently only possible for a "done" edit
+// to a recurring task), or are zero if there was none.  An Op whose
+// Kind is opUndoMark or opRedoMark carries no other fields; it only
+// marks where the undo position was at the time it was journaled.
+type Op struct {
+	Kind      opKind    `json:"kind"`
+	TaskID    int       `json:"task_id"`
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+	AddedID   int       `json:"added_id,omitempty"`
+	AddedText string    `json:"added_text,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// A History is a bounded undo/redo log of Ops for one file, optionally
+// persisted to an append-only sidecar journal so that it survives
+// across restarts and is shared by every acme session editing the
+// same file.
+type History struct {
+	mu      sync.Mutex
+	ops     []Op
+	pos     int
+	cap     int
+	journal *os.File
+}
+
+// newHistory returns a History that keeps at most capacity ops.  If
+// journalPath is non-empty, prior ops are replayed from it (to
+// restore undo state across restarts) and future ops are appended to
+// it as newline-delimited JSON.
+func newHistory(capacity int, journalPath string) *History {
+	h := &History{cap: capacity}
+	if journalPath == "" {
+		return h
+	}
+
+	if f, err := os.Open(journalPath); err == nil {
+		dec := json.NewDecoder(f)
+		for {
+			var op Op
+			if err := dec.Decode(&op); err != nil {
+				break
+			}
+			switch op.Kind {
+			case opUndoMark:
+				if h.pos > 0 {
+					h.pos--
+				}
+			case opRedoMark:
+				if h.pos < len(h.ops) {
+					h.pos++
+				}
+			default:
+				h.append(op)
+			}
+		}
+		f.Close()
+	}
+
+	f, err := os.OpenFile(journalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open journal", journalPath, ":", err)
+		return h
+	}
+	h.journal = f
+	return h
+}
+
+// journalPathFor returns the sidecar journal path for a FileStore
+// rooted at p, or "" if journaling isn't applicable (e.g. a remote
+// store with no meaningful local directory).
+func journalPathFor(s todotxt.Store, p string) string {
+	if _, ok := s.(*todotxt.FileStore); !ok {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(p), ".todo.journal")
+}
+
+// record appends op to the in-memory log, discarding any redo tail,
+// and to the journal file if one is open.
+func (h *History) record(op Op) {
+	h.mu.Lock()
+	h.append(op)
+	h.mu.Unlock()
+
+	if h.journal == nil {
+		return
+	}
+	if err := json.NewEncoder(h.journal).Encode(op); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write journal entry:", err)
+	}
+}
+
+// append adds op to the log, evicting the oldest entry once the log
+// reaches its capacity.
+func (h *History) append(op Op) {
+	if h.pos < len(h.ops) {
+		h.ops = h.ops[:h.pos]
+	}
+	h.ops = append(h.ops, op)
+	if h.cap > 0 && len(h.ops) > h.cap {
+		h.ops = h.ops[len(h.ops)-h.cap:]
+	}
+	h.pos = len(h.ops)
+}
+
+// Undo returns the most recent not-yet-undone Op and moves the undo
+// position back past it, or returns ok false if there is nothing to
+// undo.  The position change is journaled, if a journal is open, so
+// it survives a restart.
+func (h *History) Undo() (op Op, ok bool) {
+	h.mu.Lock()
+	if h.pos == 0 {
+		h.mu.Unlock()
+		return Op{}, false
+	}
+	h.pos--
+	op = h.ops[h.pos]
+	h.mu.Unlock()
+	h.journalMark(opUndoMark)
+	return op, true
+}
+
+// Redo returns the next previously-undone Op and moves the undo
+// position past it, or returns ok false if there is nothing to redo.
+// The position change is journaled, if a journal is open, so it
+// survives a restart.
+func (h *History) Redo() (op Op, ok bool) {
+	h.mu.Lock()
+	if h.pos >= len(h.ops) {
+		h.mu.Unlock()
+		return Op{}, false
+	}
+	op = h.ops[h.pos]
+	h.pos++
+	h.mu.Unlock()
+	h.journalMark(opRedoMark)
+	return op, true
+}
+
+// journalMark appends a position-only Op of the given kind to the
+// journal file, if one is open.
+func (h *History) journalMark(kind opKind) {
+	if h.journal == nil {
+		return
+	}
+	if err := json.NewEncoder(h.journal).Encode(Op{Kind: kind, Time: time.Now()}); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write journal entry:", err)
+	}
+}
+
+// doTask marks the task with the given id done, recording the edit in
+// history.
+func doTask(id int) error {
+	t, ok := list.GetTask(id)
+	if !ok {
+		return fmt.Errorf("no such task: %d", id)
+	}
+	before := t.String()
+
+	_, next, ok := list.Complete(id)
+	if !ok {
+		return fmt.Errorf("no such task: %d", id)
+	}
+
+	op := Op{Kind: opDone, TaskID: id, Before: before, After: t.String(), Time: time.Now()}
+	if next != nil {
+		op.AddedID = next.ID()
+		op.AddedText = next.String()
+	}
+	history.record(op)
+	return saveList()
+}
+
+// reopenTask reopens the task with the given id, recording the edit
+// in history.
+func reopenTask(id int) error {
+	t, ok := list.GetTask(id)
+	if !ok {
+		return fmt.Errorf("no such task: %d", id)
+	}
+	before := t.String()
+	t.Reopen()
+	list.Touch()
+	history.record(Op{Kind: opReopen, TaskID: id, Before: before, After: t.String(), Time: time.Now()})
+	return saveList()
+}
+
+// setTaskPriority sets the priority of the task with the given id,
+// recording the edit in history.  p must be a rune in
+// todotxt.PriorityRunes.
+func setTaskPriority(id int, p rune) error {
+	if !strings.ContainsRune(todotxt.PriorityRunes, p) {
+		return fmt.Errorf("invalid priority: %c", p)
+	}
+	t, ok := list.GetTask(id)
+	if !ok {
+		return fmt.Errorf("no such task: %d", id)
+	}
+	before := t.String()
+	t.SetPriority(p)
+	list.Touch()
+	history.record(Op{Kind: opPriority, TaskID: id, Before: before, After: t.String(), Time: time.Now()})
+	return saveList()
+}
+
+// undo reverts the most recent recorded edit, if any.
+func undo() bool {
+	op, ok := history.Undo()
+	if !ok {
+		return false
+	}
+	applyOpText(op.TaskID, op.Before)
+	if op.AddedID != 0 {
+		list.Remove(op.AddedID)
+	} else {
+		list.Touch()
+	}
+	if err := saveList(); err != nil {
+		fmt.Fprintln(os.Stderr, "Undo:", err)
+	}
+	return true
+}
+
+// redo reapplies the most recently undone edit, if any.
+func redo() bool {
+	op, ok := history.Redo()
+	if !ok {
+		return false
+	}
+	applyOpText(op.TaskID, op.After)
+	if op.AddedID != 0 && op.AddedText != "" {
+		added := todotxt.MakeTask(op.AddedText)
+		list.AddWithID(&added, op.AddedID)
+	} else {
+		list.Touch()
+	}
+	if err := saveList(); err != nil {
+		fmt.Fprintln(os.Stderr, "Redo:", err)
+	}
+	return true
+}
+
+// applyOpText restores the task named by id to the given todo.txt
+// line, if the task is still present in the list.
+func applyOpText(id int, text string) {
+	if t, ok := list.GetTask(id); ok {
+		t.SetText(text)
+	}
+}
@@ -0,0 +1,61 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryUndoRedo(t *testing.T) {
+	h := newHistory(10, "")
+	h.record(Op{Kind: opDone, TaskID: 1, Before: "Call Mom", After: "x Call Mom"})
+
+	op, ok := h.Undo()
+	if !ok || op.TaskID != 1 {
+		t.Fatalf("Undo() = %v, %t; want the recorded op", op, ok)
+	}
+	if _, ok := h.Undo(); ok {
+		t.Errorf("Undo() should fail with nothing left to undo")
+	}
+
+	op, ok = h.Redo()
+	if !ok || op.TaskID != 1 {
+		t.Fatalf("Redo() = %v, %t; want the recorded op", op, ok)
+	}
+	if _, ok := h.Redo(); ok {
+		t.Errorf("Redo() should fail with nothing left to redo")
+	}
+}
+
+func TestHistoryJournalReplaysUndoPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, ".todo.journal")
+
+	h := newHistory(10, journal)
+	h.record(Op{Kind: opDone, TaskID: 1, Before: "Call Mom", After: "x Call Mom"})
+	h.record(Op{Kind: opDone, TaskID: 2, Before: "Pay rent", After: "x Pay rent"})
+	if _, ok := h.Undo(); !ok {
+		t.Fatalf("Undo() should succeed")
+	}
+
+	reopened := newHistory(10, journal)
+	if _, ok := reopened.Redo(); !ok {
+		t.Fatalf("Redo() should succeed after replay")
+	}
+	if _, ok := reopened.Redo(); ok {
+		t.Errorf("Redo() should fail: only one op was undone before restart")
+	}
+	if op, ok := reopened.Undo(); !ok || op.TaskID != 2 {
+		t.Fatalf("Undo() after replay = %v, %t; want the second op", op, ok)
+	}
+	if op, ok := reopened.Undo(); !ok || op.TaskID != 1 {
+		t.Fatalf("Undo() after replay = %v, %t; want the first op", op, ok)
+	}
+}
@@ -5,61 +5,78 @@ package main
 import (
 	"fmt"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
-	"unicode"
-	"unicode/utf8"
 
 	"code.google.com/p/eaburns.todo/acme"
 	"code.google.com/p/eaburns.todo/todotxt"
 )
 
-// A listWin is a window listing the todo.txt file, possibly with some
-// filters applied to it.
+// A listWin is a window listing list, filtered by a query typed into
+// its tag and sorted according to the window's own settings.  Every
+// listWin shares the same *todotxt.TaskList, so a change made through
+// one window is picked up by every other open window via the list's
+// notification channel.
 type listWin struct {
 	*acme.Win
-	title   string
-	filters []string
-	less    func([]todotxt.Task, int, int) bool
+	title     string
+	queryText string
+	query     todotxt.Query
+	sort      todotxt.SortFlag
+	changes   <-chan struct{}
+	done      chan struct{}
 }
 
-// NewListWin creates a new list window for this set of filters.
-func newListWin(filters []string) {
-	title := fmt.Sprintf("%s/%s", path, strings.Join(filters, ""))
-	win, err := acme.New(title)
+// NewListWin creates a new list window for the given query string.
+func newListWin(query string) *listWin {
+	q, err := todotxt.ParseQuery(query)
 	if err != nil {
-		die(1, "Failed to create a new window %s: %s", title, err)
+		die(1, "Invalid query %q: %s", query, err)
 	}
-	if err := win.Fprintf("tag", "Sort "); err != nil {
+
+	title := fmt.Sprintf("%s/%s", path, query)
+	win, werr := acme.New(title)
+	if werr != nil {
+		die(1, "Failed to create a new window %s: %s", title, werr)
+	}
+	if err := win.Fprintf("tag", "Sort Do Reopen Pri Undo Redo "); err != nil {
 		die(1, "Failed to write the tag of %s: %s", title, err)
 	}
 	lw := &listWin{
-		Win:     win,
-		title:   title,
-		filters: filters,
-		less:    lessFuncs["prio"],
+		Win:       win,
+		title:     title,
+		queryText: query,
+		query:     q,
+		sort:      sortFlags["prio"],
+		changes:   list.Subscribe(),
+		done:      make(chan struct{}),
 	}
-	wg.Add(1)
+	wg.Add(2)
+	go lw.watchChanges()
 	go lw.events()
 	lw.refresh()
+	return lw
 }
 
-// lessFuncs is a map of less functions for sorting
-var lessFuncs = map[string]func([]todotxt.Task, int, int) bool{
-	"line": func(_ []todotxt.Task, i, j int) bool {
-		return i < j
-	},
-	"prio": func(ts []todotxt.Task, i, j int) bool {
-		switch a, b := ts[i], ts[j]; {
-		case !a.IsDone() && b.IsDone():
-			return true
-		case a.IsDone() && !b.IsDone():
-			return false
-		case a.Priority() != b.Priority():
-			return a.Priority() < b.Priority()
+// WatchChanges refreshes the window whenever another window's edits
+// change the shared list, until the window is deleted.
+func (lw *listWin) watchChanges() {
+	defer wg.Done()
+	for {
+		select {
+		case <-lw.changes:
+			lw.refresh()
+		case <-lw.done:
+			return
 		}
-		return i < j
-	},
+	}
+}
+
+// sortFlags is a map of named sort orders selectable from the tag.
+var sortFlags = map[string]todotxt.SortFlag{
+	"line": 0,
+	"prio": todotxt.SortCompletedFirst | todotxt.SortPriorityAsc,
+	"due":  todotxt.SortCompletedFirst | todotxt.SortOverdueFirst | todotxt.SortPriorityAsc,
 }
 
 // Events deals with the window events, meant to be run in a
@@ -75,16 +92,73 @@ func (lw *listWin) events() {
 
 		case ev.C2 == 'x' || ev.C2 == 'X':
 			fs := strings.Fields(string(ev.Text))
+			if len(fs) >= 1 && fs[0] == "Do" {
+				if len(fs) < 2 {
+					fmt.Fprintln(os.Stderr, "Usage: Do <task number>")
+					continue
+				}
+				id, err := strconv.Atoi(fs[1])
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Do: not a task number:", fs[1])
+					continue
+				}
+				if err := doTask(id); err != nil {
+					fmt.Fprintln(os.Stderr, "Do:", err)
+				}
+				continue
+			}
+			if len(fs) >= 1 && fs[0] == "Reopen" {
+				if len(fs) < 2 {
+					fmt.Fprintln(os.Stderr, "Usage: Reopen <task number>")
+					continue
+				}
+				id, err := strconv.Atoi(fs[1])
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Reopen: not a task number:", fs[1])
+					continue
+				}
+				if err := reopenTask(id); err != nil {
+					fmt.Fprintln(os.Stderr, "Reopen:", err)
+				}
+				continue
+			}
+			if len(fs) >= 1 && fs[0] == "Pri" {
+				if len(fs) < 3 || len(fs[2]) != 1 {
+					fmt.Fprintln(os.Stderr, "Usage: Pri <task number> <A-Z>")
+					continue
+				}
+				id, err := strconv.Atoi(fs[1])
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Pri: not a task number:", fs[1])
+					continue
+				}
+				if err := setTaskPriority(id, rune(fs[2][0])); err != nil {
+					fmt.Fprintln(os.Stderr, "Pri:", err)
+				}
+				continue
+			}
+			if len(fs) >= 1 && fs[0] == "Undo" {
+				if !undo() {
+					fmt.Fprintln(os.Stderr, "Undo: nothing to undo")
+				}
+				continue
+			}
+			if len(fs) >= 1 && fs[0] == "Redo" {
+				if !redo() {
+					fmt.Fprintln(os.Stderr, "Redo: nothing to redo")
+				}
+				continue
+			}
 			if len(fs) >= 1 && fs[0] == "Sort" {
 				if len(fs) > 1 {
-					if less, ok := lessFuncs[fs[1]]; ok {
-						lw.less = less
+					if flag, ok := sortFlags[fs[1]]; ok {
+						lw.sort = flag
 						lw.refresh()
 						continue
 					}
 				}
 				lst := ""
-				for n := range lessFuncs {
+				for n := range sortFlags {
 					lst += n + " "
 				}
 				lst = strings.TrimSpace(lst)
@@ -96,80 +170,34 @@ func (lw *listWin) events() {
 					die(1, "Failed to write an event to %s: %s", lw.title, err)
 				}
 				if len(fs) > 0 && fs[0] == "Del" {
+					close(lw.done)
 					return
 				}
 			}
-			if filterOk(fs) {
-				fsNew := make([]string, len(lw.filters))
-				copy(fsNew, lw.filters)
-				for _, f := range fs {
-					found := false
-					for _, f2 := range fsNew {
-						if f == f2 {
-							found = true
-							break
-						}
-					}
-					if !found {
-						fsNew = append(fsNew, f)
-					}
+			if clicked := strings.Join(fs, " "); clicked != "" {
+				combined := strings.TrimSpace(lw.queryText + " " + clicked)
+				if _, err := todotxt.ParseQuery(combined); err == nil {
+					newListWin(combined)
 				}
-				newListWin(fsNew)
 			}
 		}
 	}
 }
 
-// FilterOk returns true if every element of the slice is a valid filter tag.
-func filterOk(fs []string) bool {
-	for _, f := range fs {
-		if f[0] != todotxt.ProjectTag && f[0] != todotxt.ContextTag {
-			return false
-		}
-		l, _ := utf8.DecodeLastRuneInString(f)
-		if !unicode.IsLetter(l) && !unicode.IsDigit(l) && l != '_' {
-			return false
-		}
-	}
-	return true
-}
-
-// Refresh refreshes the window's body by re-parsing the file.
+// Refresh refreshes the window's body from the shared list.
 func (lw *listWin) refresh() {
-	var inds []int
-	for i, task := range file.Tasks {
-		ok := true
-		for _, filter := range lw.filters {
-			if !task.HasTag(filter) {
-				ok = false
-				break
-			}
-		}
-		if ok {
-			inds = append(inds, i)
-		}
-	}
-
-	sort.Sort(sorter{inds, file.Tasks, lw.less})
-
-	projs := make(map[string]bool)
-	ctxs := make(map[string]bool)
+	filtered := list.Filter(lw.query.Matches)
+	filtered.Sort(lw.sort)
+	tasks := filtered.Tasks()
 
 	if err := lw.Addr(","); err != nil {
 		die(1, "Failed to set address for %s: %s", lw.title, err)
 	}
 
-	for _, i := range inds {
-		task := file.Tasks[i]
-		if _, err := fmt.Fprintf(lw.Data, "%5d. %s\n", i+1, task.String()); err != nil {
+	for _, t := range tasks {
+		if _, err := fmt.Fprintf(lw.Data, "%5d. %s\n", t.ID(), t.String()); err != nil {
 			die(1, "Failed to refresh window %s: %s", lw.title, err)
 		}
-		for _, t := range task.Tags(todotxt.ProjectTag) {
-			projs[t] = true
-		}
-		for _, t := range task.Tags(todotxt.ContextTag) {
-			ctxs[t] = true
-		}
 	}
 
 	if err := lw.Addr("#0"); err != nil {
@@ -185,22 +213,3 @@ func (lw *listWin) refresh() {
 		die(1, "Failed to write clean to %s ctl: %s", lw.title, err)
 	}
 }
-
-// A sorter sorts the indices using the less function from the listWin.
-type sorter struct {
-	inds  []int
-	tasks []todotxt.Task
-	less  func([]todotxt.Task, int, int) bool
-}
-
-func (s sorter) Len() int {
-	return len(s.inds)
-}
-
-func (s sorter) Swap(i, j int) {
-	s.inds[i], s.inds[j] = s.inds[j], s.inds[i]
-}
-
-func (s sorter) Less(i, j int) bool {
-	return s.less(s.tasks, s.inds[i], s.inds[j])
-}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -11,21 +12,33 @@ import (
 	"code.google.com/p/eaburns.todo/todotxt"
 )
 
+// historyCap bounds how many edits Undo/Redo can reach back through.
+const historyCap = 100
+
 var (
-	path string
-	file todotxt.File
-	wg   sync.WaitGroup
+	path    string
+	store   todotxt.Store
+	list    *todotxt.TaskList
+	history *History
+	wg      sync.WaitGroup
 )
 
 func main() {
 	if len(os.Args) != 2 {
-		die(2, "Usage: todo <todo.txt path>\n")
+		die(2, "Usage: todo <todo.txt path or URI>\n")
 	}
-	path = os.Args[1]
 
-	file = readFile()
+	store = newStore(os.Args[1])
+
+	var err error
+	list, err = store.Load()
+	if err != nil {
+		die(1, "Failed to load %s: %s\n", path, err)
+	}
+	history = newHistory(historyCap, journalPathFor(store, path))
+	go watchStore()
 
-	win := newListWin(nil)
+	win := newListWin("")
 	if wd, err := os.Getwd(); err != nil {
 		panic("Failed to set dump working directory: " + err.Error())
 	} else {
@@ -36,22 +49,82 @@ func main() {
 	wg.Wait()
 }
 
-// Die prints a message to standard error and exits with the given status.
-func die(status int, f string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, f, args...)
-	os.Exit(status)
+// NewStore selects and constructs the todotxt.Store named by arg,
+// based on its URI scheme: a bare path or a file: URI gives a
+// FileStore, http: and https: give an HTTPStore, and caldav: and
+// caldavs: give a CalDAVStore backed by the equivalent http(s) URL.
+// It also sets the path global used for window titles.
+func newStore(arg string) todotxt.Store {
+	path = arg
+
+	u, err := url.Parse(arg)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		p := arg
+		if err == nil && u.Scheme == "file" {
+			p = u.Path
+		}
+		path = p
+		fs, err := todotxt.NewFileStore(p)
+		if err != nil {
+			die(1, "Failed to watch %s: %s\n", p, err)
+		}
+		return fs
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return todotxt.NewHTTPStore(arg)
+
+	case "caldav", "caldavs":
+		httpURL := *u
+		if u.Scheme == "caldav" {
+			httpURL.Scheme = "http"
+		} else {
+			httpURL.Scheme = "https"
+		}
+		return todotxt.NewCalDAVStore(httpURL.String())
+
+	default:
+		die(2, "Unsupported URI scheme %q in %s\n", u.Scheme, arg)
+		return nil
+	}
 }
 
-// ReadFile returns the todotxt.File.
-func readFile() todotxt.File {
-	in, err := os.Open(path)
-	if err != nil {
-		die(1, "Failed to open %s: %s\n", path, err)
+// WatchStore reloads the list whenever store reports an external
+// change, so that every open list window picks up the reload through
+// list's own notification channel.
+func watchStore() {
+	for range store.Watch() {
+		reloaded, err := store.Load()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to reload", path, ":", err)
+			continue
+		}
+		list.ReplaceAll(reloaded)
+	}
+}
+
+// SaveList persists list to store.  If the store reports that its data
+// was changed concurrently (todotxt.ErrConflict), the local list is
+// replaced with the store's latest contents so the caller isn't left
+// editing stale state, and the edit that triggered the save is lost;
+// the caller should report this to the user.
+func saveList() error {
+	err := store.Save(list)
+	if err == todotxt.ErrConflict {
+		if reloaded, rerr := store.Load(); rerr == nil {
+			list.ReplaceAll(reloaded)
+		}
+		return fmt.Errorf("%s changed since it was last loaded; reloaded the latest version, please redo your edit", path)
 	}
-	defer in.Close()
-	file, err := todotxt.ReadFile(in)
 	if err != nil {
-		die(1, "Failed to read %s: %s\n", path, err)
+		return fmt.Errorf("failed to save %s: %s", path, err)
 	}
-	return file
+	return nil
+}
+
+// Die prints a message to standard error and exits with the given status.
+func die(status int, f string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, f, args...)
+	os.Exit(status)
 }
@@ -0,0 +1,303 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UIDKeyword is the keyword under which a CalDAVStore records the
+// iCalendar UID it has assigned a task, so that later syncs update
+// the same VTODO rather than creating a duplicate.
+const UIDKeyword = "uid"
+
+// A CalDAVStore is a Store that represents a todo.txt file as an
+// iCalendar VCALENDAR resource, with one VTODO per task, synced over
+// plain HTTP GET/PUT against a CalDAV/WebDAV collection URL.  It does
+// not implement the full CalDAV REPORT/PROPFIND protocol: it treats
+// the URL as a single calendar resource, the way a WebDAV server
+// would expose a single .ics file.
+type CalDAVStore struct {
+	URL    string
+	Client *http.Client
+
+	etag    string
+	nextUID int
+}
+
+// NewCalDAVStore returns a CalDAVStore for the calendar resource at
+// url.
+func NewCalDAVStore(url string) *CalDAVStore {
+	return &CalDAVStore{URL: url, Client: http.DefaultClient}
+}
+
+// Load GETs the store's URL and parses its VTODO components into a
+// TaskList.
+func (s *CalDAVStore) Load() (*TaskList, error) {
+	resp, err := s.client().Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("todotxt: GET " + s.URL + ": " + resp.Status)
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	s.etag = resp.Header.Get("ETag")
+
+	tasks, err := decodeVCalendar(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	l := NewTaskList()
+	for _, t := range tasks {
+		l.Add(t)
+	}
+	return l, nil
+}
+
+// Save assigns a uid: keyword to any task that doesn't already have
+// one, encodes every task in l as a VTODO and PUTs the resulting
+// VCALENDAR to the store's URL, using the ETag from the last Load as
+// an If-Match precondition.
+func (s *CalDAVStore) Save(l *TaskList) error {
+	tasks := l.Tasks()
+	for _, t := range tasks {
+		if t.Tags[UIDKeyword] == "" {
+			s.nextUID++
+			t.Tags[UIDKeyword] = fmt.Sprintf("todotxt-%d-%d", time.Now().Unix(), s.nextUID)
+		}
+	}
+
+	body := encodeVCalendar(tasks)
+	req, err := http.NewRequest(http.MethodPut, s.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-Match", s.etag)
+	}
+	req.Header.Set("Content-Type", "text/calendar")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusCreated:
+		s.etag = resp.Header.Get("ETag")
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return ErrConflict
+	default:
+		return errors.New("todotxt: PUT " + s.URL + ": " + resp.Status)
+	}
+}
+
+// Watch returns a channel that is never sent on, for the same reason
+// as HTTPStore.Watch.
+func (s *CalDAVStore) Watch() <-chan Event {
+	return make(chan Event)
+}
+
+func (s *CalDAVStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// icsDateFormat is the basic (no separators) iCalendar DATE format.
+const icsDateFormat = "20060102"
+
+// EncodeVCalendar renders tasks as a VCALENDAR containing one VTODO
+// per task.
+func encodeVCalendar(tasks []*Task) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//eaburns.todo//EN\r\n")
+	for _, t := range tasks {
+		b.WriteString(encodeVTodo(t))
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// EncodeVTodo renders a single task as a VTODO component.
+func encodeVTodo(t *Task) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VTODO\r\n")
+	fmt.Fprintf(&b, "UID:%s\r\n", t.Tags[UIDKeyword])
+	if t.Description != "" {
+		fmt.Fprintf(&b, "SUMMARY:%s\r\n", t.Description)
+	}
+	if p := icsPriority(t.Priority); p != 0 {
+		fmt.Fprintf(&b, "PRIORITY:%d\r\n", p)
+	}
+	if due, ok := t.DueDate(); ok {
+		fmt.Fprintf(&b, "DUE:%s\r\n", due.Format(icsDateFormat))
+	}
+	if cats := icsCategories(t); cats != "" {
+		fmt.Fprintf(&b, "CATEGORIES:%s\r\n", cats)
+	}
+	if t.Done {
+		b.WriteString("STATUS:COMPLETED\r\n")
+	} else {
+		b.WriteString("STATUS:NEEDS-ACTION\r\n")
+	}
+	if rrule := icsRRule(t.Tags[RecurKeyword]); rrule != "" {
+		fmt.Fprintf(&b, "RRULE:%s\r\n", rrule)
+	}
+	b.WriteString("END:VTODO\r\n")
+	return b.String()
+}
+
+// IcsPriority maps a todo.txt priority rune 'A'..'I' to the
+// iCalendar 1..9 priority scale used by PRIORITY.  Any other
+// priority, including none, maps to 0 (not set).
+func icsPriority(p rune) int {
+	if p < 'A' || p > 'I' {
+		return 0
+	}
+	return int(p-'A') + 1
+}
+
+// IcsCategories renders a task's projects and contexts as a
+// comma-separated CATEGORIES value, keeping their +/@ markers so that
+// decodeVTodo can tell them apart again.
+func icsCategories(t *Task) string {
+	cats := append(append([]string{}, t.Projects...), t.Contexts...)
+	return strings.Join(cats, ",")
+}
+
+// IcsRRule converts a rec: value into an RRULE value.  Business-day
+// recurrences have no iCalendar equivalent and are omitted.
+func icsRRule(rec string) string {
+	if rec == "" {
+		return ""
+	}
+	_, n, unit, err := parseRecurrence(rec)
+	if err != nil {
+		return ""
+	}
+	var freq string
+	switch unit {
+	case 'd':
+		freq = "DAILY"
+	case 'w':
+		freq = "WEEKLY"
+	case 'm':
+		freq = "MONTHLY"
+	case 'y':
+		freq = "YEARLY"
+	default:
+		return ""
+	}
+	return fmt.Sprintf("FREQ=%s;INTERVAL=%d", freq, n)
+}
+
+// DecodeVCalendar parses the VTODO components of a VCALENDAR document
+// into Tasks.
+func decodeVCalendar(ics string) ([]*Task, error) {
+	var tasks []*Task
+	lines := strings.Split(strings.Replace(ics, "\r\n", "\n", -1), "\n")
+
+	var cur map[string]string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "BEGIN:VTODO":
+			cur = make(map[string]string)
+		case line == "END:VTODO":
+			if cur != nil {
+				tasks = append(tasks, decodeVTodo(cur))
+				cur = nil
+			}
+		case cur != nil:
+			i := strings.IndexByte(line, ':')
+			if i < 0 {
+				continue
+			}
+			cur[line[:i]] = line[i+1:]
+		}
+	}
+	return tasks, nil
+}
+
+// DecodeVTodo builds a Task from a VTODO component's property map.
+func decodeVTodo(props map[string]string) *Task {
+	t := &Task{Tags: make(map[string]string)}
+	t.Description = props["SUMMARY"]
+	t.Done = props["STATUS"] == "COMPLETED"
+
+	if uid := props["UID"]; uid != "" {
+		t.Tags[UIDKeyword] = uid
+	}
+	if n, err := strconv.Atoi(props["PRIORITY"]); err == nil && n >= 1 && n <= 9 {
+		t.Priority = 'A' + rune(n-1)
+	}
+	if due, err := time.Parse(icsDateFormat, props["DUE"]); err == nil {
+		t.SetDueDate(due)
+	}
+	for _, cat := range strings.Split(props["CATEGORIES"], ",") {
+		switch {
+		case strings.HasPrefix(cat, string(ProjectTag)):
+			t.Projects = append(t.Projects, cat)
+		case strings.HasPrefix(cat, string(ContextTag)):
+			t.Contexts = append(t.Contexts, cat)
+		}
+	}
+	if rrule := props["RRULE"]; rrule != "" {
+		if rec := recFromRRule(rrule); rec != "" {
+			t.Tags[RecurKeyword] = rec
+		}
+	}
+	return t
+}
+
+// RecFromRRule converts a simple FREQ=...;INTERVAL=... RRULE back
+// into a rec: value.
+func recFromRRule(rrule string) string {
+	var freq string
+	n := 1
+	for _, kv := range strings.Split(rrule, ";") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			continue
+		}
+		key, val := kv[:i], kv[i+1:]
+		switch key {
+		case "FREQ":
+			freq = val
+		case "INTERVAL":
+			if v, err := strconv.Atoi(val); err == nil {
+				n = v
+			}
+		}
+	}
+	var unit string
+	switch freq {
+	case "DAILY":
+		unit = "d"
+	case "WEEKLY":
+		unit = "w"
+	case "MONTHLY":
+		unit = "m"
+	case "YEARLY":
+		unit = "y"
+	default:
+		return ""
+	}
+	return strconv.Itoa(n) + unit
+}
@@ -0,0 +1,57 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import "testing"
+
+func TestVTodoRoundTrip(t *testing.T) {
+	task := MakeTask("(A) Call Mom +Family @Phone due:2014-02-01 rec:1m")
+	task.Tags[UIDKeyword] = "uid-1"
+
+	ics := encodeVCalendar([]*Task{&task})
+	tasks, err := decodeVCalendar(ics)
+	if err != nil {
+		t.Fatalf("decodeVCalendar returned error: %s", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("expected 1 decoded task, got %d", len(tasks))
+	}
+
+	got := tasks[0]
+	if got.Description != task.Description {
+		t.Errorf("expected description %q, got %q", task.Description, got.Description)
+	}
+	if got.Priority != task.Priority {
+		t.Errorf("expected priority %c, got %c", task.Priority, got.Priority)
+	}
+	if due, ok := got.DueDate(); !ok || due.Format(DateFormat) != "2014-02-01" {
+		t.Errorf("expected due 2014-02-01, got %v (ok=%t)", due, ok)
+	}
+	if got.Tags[RecurKeyword] != "1m" {
+		t.Errorf("expected rec:1m, got rec:%s", got.Tags[RecurKeyword])
+	}
+	if len(got.Projects) != 1 || got.Projects[0] != "+Family" {
+		t.Errorf("expected project +Family, got %v", got.Projects)
+	}
+	if len(got.Contexts) != 1 || got.Contexts[0] != "@Phone" {
+		t.Errorf("expected context @Phone, got %v", got.Contexts)
+	}
+}
+
+func TestIcsPriority(t *testing.T) {
+	tests := []struct {
+		prio rune
+		want int
+	}{
+		{0, 0},
+		{'A', 1},
+		{'I', 9},
+		{'J', 0},
+		{'Z', 0},
+	}
+	for _, test := range tests {
+		if got := icsPriority(test.prio); got != test.want {
+			t.Errorf("icsPriority(%c) = %d, want %d", test.prio, got, test.want)
+		}
+	}
+}
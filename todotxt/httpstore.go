@@ -0,0 +1,105 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// ErrConflict is returned by HTTPStore.Save and CalDAVStore.Save when
+// the remote resource was modified since the last Load, as detected
+// by a failed If-Match/ETag precondition.
+var ErrConflict = errors.New("todotxt: remote resource was modified concurrently")
+
+// An HTTPStore is a Store backed by a todo.txt file served over
+// HTTP(S).  Save uses the ETag returned by the most recent Load as an
+// If-Match precondition, so a concurrent edit on the server is
+// reported as ErrConflict rather than silently overwritten.
+type HTTPStore struct {
+	URL    string
+	Client *http.Client
+
+	etag string
+}
+
+// NewHTTPStore returns an HTTPStore for the todo.txt file at url.
+func NewHTTPStore(url string) *HTTPStore {
+	return &HTTPStore{URL: url, Client: http.DefaultClient}
+}
+
+// Load GETs the store's URL and parses the response body as a
+// todo.txt file, remembering its ETag for a subsequent Save.
+func (s *HTTPStore) Load() (*TaskList, error) {
+	resp, err := s.client().Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("todotxt: GET " + s.URL + ": " + resp.Status)
+	}
+
+	f, err := ReadFile(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.etag = resp.Header.Get("ETag")
+
+	l := NewTaskList()
+	for i := range f.Tasks {
+		l.Add(&f.Tasks[i])
+	}
+	return l, nil
+}
+
+// Save PUTs l to the store's URL, setting If-Match to the ETag seen
+// by the last Load.  If the server rejects the precondition (412) or
+// reports a conflict (409), Save returns ErrConflict.
+func (s *HTTPStore) Save(l *TaskList) error {
+	var buf bytes.Buffer
+	f := File{Tasks: l.taskValues()}
+	if _, err := f.WriteTo(&buf); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, s.URL, &buf)
+	if err != nil {
+		return err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-Match", s.etag)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusCreated:
+		s.etag = resp.Header.Get("ETag")
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return ErrConflict
+	default:
+		return errors.New("todotxt: PUT " + s.URL + ": " + resp.Status)
+	}
+}
+
+// Watch returns a channel that is never sent on: HTTPStore has no way
+// to learn of a remote edit other than Load discovering a changed
+// ETag, so it cannot proactively report external changes.
+func (s *HTTPStore) Watch() <-chan Event {
+	return make(chan Event)
+}
+
+func (s *HTTPStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
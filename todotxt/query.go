@@ -0,0 +1,294 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Query is a compiled filter expression, as parsed by ParseQuery.
+// A Query matches a Task if any of its OR-groups matches; an
+// OR-group matches if every one of its terms matches.
+//
+//	+Novel @Computer !done due:<=today | pri:A
+//
+// parses into two OR-groups: one requiring the +Novel project, the
+// @Computer context, not done and due on or before today, and one
+// requiring priority A.
+type Query struct {
+	groups [][]term
+}
+
+// A term is a single predicate within an OR-group, optionally negated.
+type term struct {
+	negate bool
+	match  func(*Task) bool
+}
+
+// Matches reports whether t satisfies the query.
+func (q Query) Matches(t *Task) bool {
+	if len(q.groups) == 0 {
+		return true
+	}
+	for _, group := range q.groups {
+		if groupMatches(group, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupMatches(group []term, t *Task) bool {
+	for _, trm := range group {
+		ok := trm.match(t)
+		if trm.negate {
+			ok = !ok
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseQuery parses a filter query string into a Query.
+//
+// A query is one or more OR-groups separated by '|'.  Each OR-group
+// is a space-separated list of terms, all of which must match.  A
+// term may be:
+//
+//	+project        exact project tag
+//	@context        exact context tag
+//	key:value       exact keyword tag, e.g. rec:1m
+//	due:<date       due date predicate; operators <, <=, >, >=, or
+//	                a bare value for equality; date is either
+//	                YYYY-MM-DD or "today"
+//	pri:A           exact priority
+//	pri:A-C         priority range, inclusive
+//	done:true       completion status
+//	done:false
+//	done            shorthand for done:true
+//	"some text"     case-insensitive substring search of the
+//	                description
+//	word            same as above, for a single unquoted word
+//
+// Any term may be prefixed with '!' to negate it.
+func ParseQuery(s string) (Query, error) {
+	toks, err := tokenizeQuery(s)
+	if err != nil {
+		return Query{}, err
+	}
+
+	var q Query
+	var group []term
+	for _, tok := range toks {
+		if tok == "|" {
+			q.groups = append(q.groups, group)
+			group = nil
+			continue
+		}
+		trm, err := parseTerm(tok)
+		if err != nil {
+			return Query{}, err
+		}
+		group = append(group, trm)
+	}
+	q.groups = append(q.groups, group)
+	return q, nil
+}
+
+// TokenizeQuery splits a query string on whitespace, keeping
+// double-quoted substrings together as a single token.
+func tokenizeQuery(s string) ([]string, error) {
+	var toks []string
+	i := 0
+	for i < len(s) {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+		if s[i] == '"' || (s[i] == '!' && i+1 < len(s) && s[i+1] == '"') {
+			qi := i
+			if s[qi] == '!' {
+				qi++
+			}
+			j := strings.IndexByte(s[qi+1:], '"')
+			if j < 0 {
+				return nil, errors.New("todotxt: unterminated quoted string")
+			}
+			end := qi + 1 + j + 1
+			toks = append(toks, s[i:end])
+			i = end
+			continue
+		}
+		j := strings.IndexByte(s[i:], ' ')
+		if j < 0 {
+			toks = append(toks, s[i:])
+			break
+		}
+		toks = append(toks, s[i:i+j])
+		i += j
+	}
+	return toks, nil
+}
+
+// ParseTerm parses a single query token into a term.
+func parseTerm(tok string) (term, error) {
+	negate := false
+	if strings.HasPrefix(tok, "!") {
+		negate = true
+		tok = tok[1:]
+	}
+	if tok == "" {
+		return term{}, errors.New("todotxt: empty query term")
+	}
+
+	match, err := parseMatch(tok)
+	if err != nil {
+		return term{}, err
+	}
+	return term{negate: negate, match: match}, nil
+}
+
+func parseMatch(tok string) (func(*Task) bool, error) {
+	switch {
+	case strings.HasPrefix(tok, `"`) && strings.HasSuffix(tok, `"`) && len(tok) >= 2:
+		return substringMatch(tok[1 : len(tok)-1]), nil
+
+	case strings.HasPrefix(tok, string(ProjectTag)):
+		return tagMatch(func(t *Task) []string { return t.Projects }, tok), nil
+
+	case strings.HasPrefix(tok, string(ContextTag)):
+		return tagMatch(func(t *Task) []string { return t.Contexts }, tok), nil
+
+	case strings.ContainsRune(tok, KeywordSep):
+		i := strings.IndexRune(tok, KeywordSep)
+		key, val := tok[:i], tok[i+1:]
+		return keywordMatch(key, val)
+
+	case tok == "done":
+		return keywordMatch("done", "true")
+
+	default:
+		return substringMatch(tok), nil
+	}
+}
+
+func substringMatch(needle string) func(*Task) bool {
+	needle = strings.ToLower(needle)
+	return func(t *Task) bool {
+		return strings.Contains(strings.ToLower(t.Description), needle)
+	}
+}
+
+func tagMatch(tags func(*Task) []string, want string) func(*Task) bool {
+	return func(t *Task) bool {
+		for _, tg := range tags(t) {
+			if tg == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func keywordMatch(key, val string) (func(*Task) bool, error) {
+	switch key {
+	case "done":
+		want, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, errors.New("todotxt: invalid done: value " + val)
+		}
+		return func(t *Task) bool { return t.Done == want }, nil
+
+	case "pri":
+		return parsePriorityMatch(val)
+
+	case DueKeyword, ThresholdKeyword:
+		return parseDateMatch(key, val)
+
+	default:
+		return func(t *Task) bool {
+			v, ok := t.Tags[key]
+			return ok && v == val
+		}, nil
+	}
+}
+
+func parsePriorityMatch(val string) (func(*Task) bool, error) {
+	if i := strings.IndexByte(val, '-'); i > 0 && len(val) == i+2 {
+		lo, hi := rune(val[0]), rune(val[i+1])
+		if strings.ContainsRune(PriorityRunes, lo) && strings.ContainsRune(PriorityRunes, hi) {
+			return func(t *Task) bool {
+				return t.Priority != 0 && t.Priority >= lo && t.Priority <= hi
+			}, nil
+		}
+	}
+	if len(val) != 1 || !strings.ContainsRune(PriorityRunes, rune(val[0])) {
+		return nil, errors.New("todotxt: invalid pri: value " + val)
+	}
+	want := rune(val[0])
+	return func(t *Task) bool { return t.Priority == want }, nil
+}
+
+func parseDateMatch(key, val string) (func(*Task) bool, error) {
+	op := "="
+	for _, o := range []string{"<=", ">=", "<", ">"} {
+		if strings.HasPrefix(val, o) {
+			op = o
+			val = val[len(o):]
+			break
+		}
+	}
+
+	want, err := parseQueryDate(val)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(t *Task) bool {
+		var got time.Time
+		var ok bool
+		switch key {
+		case DueKeyword:
+			got, ok = t.DueDate()
+		case ThresholdKeyword:
+			got, ok = t.ThresholdDate()
+		}
+		if !ok {
+			return false
+		}
+		switch op {
+		case "<":
+			return got.Before(want)
+		case "<=":
+			return !got.After(want)
+		case ">":
+			return got.After(want)
+		case ">=":
+			return !got.Before(want)
+		default:
+			return got.Equal(want)
+		}
+	}, nil
+}
+
+// ParseQueryDate parses a date value used in a query, which is
+// either "today" or a YYYY-MM-DD date.
+func parseQueryDate(val string) (time.Time, error) {
+	if val == "today" {
+		// Parsed back like a YYYY-MM-DD value, so it compares equal
+		// to a due: date of the current local day.
+		return time.Parse(DateFormat, time.Now().Format(DateFormat))
+	}
+	d, err := time.Parse(DateFormat, val)
+	if err != nil {
+		return time.Time{}, errors.New("todotxt: invalid date " + val)
+	}
+	return d, nil
+}
@@ -0,0 +1,74 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import "testing"
+
+func TestParseQueryMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  bool
+	}{
+		{"+Novel", "Write chapter one +Novel @Computer", true},
+		{"+Other", "Write chapter one +Novel @Computer", false},
+		{"+Novel @Computer", "Write chapter one +Novel @Computer", true},
+		{"+Novel @Phone", "Write chapter one +Novel @Computer", false},
+		{"!done", "Write chapter one", true},
+		{"!done", "x 2014-01-01 Write chapter one", false},
+		{`"chapter"`, "Write chapter one", true},
+		{`"chapter two"`, "Write chapter one", false},
+		{"chapter", "Write chapter one", true},
+		{"pri:A", "(A) Call Mom", true},
+		{"pri:A", "(B) Call Mom", false},
+		{"pri:A-C", "(B) Call Mom", true},
+		{"pri:A-C", "(D) Call Mom", false},
+		{"done:true", "x 2014-01-01 Call Mom", true},
+		{"done:false", "x 2014-01-01 Call Mom", false},
+		{"due:2014-02-01", "Pay rent due:2014-02-01", true},
+		{"due:<2014-02-01", "Pay rent due:2014-01-15", true},
+		{"due:<2014-02-01", "Pay rent due:2014-02-15", false},
+		{"due:<=today", "Pay rent due:2000-01-01", true},
+		{"due:>=today", "Pay rent due:2000-01-01", false},
+		{"+Novel @Computer !done due:<=today | pri:A", "(A) Call Mom", true},
+		{"+Novel @Computer !done due:<=today | pri:A", "Buy milk", false},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) returned error: %s", test.query, err)
+			continue
+		}
+		task := MakeTask(test.text)
+		if got := q.Matches(&task); got != test.want {
+			t.Errorf("query %q on text [%s]: expected %t, got %t", test.query, test.text, test.want, got)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []string{
+		`"unterminated`,
+		"pri:",
+		"pri:AZ",
+		"done:nope",
+		"due:not-a-date",
+		"!",
+	}
+	for _, q := range tests {
+		if _, err := ParseQuery(q); err == nil {
+			t.Errorf("ParseQuery(%q) expected an error, got none", q)
+		}
+	}
+}
+
+func TestParseQueryEmpty(t *testing.T) {
+	q, err := ParseQuery("")
+	if err != nil {
+		t.Fatalf("ParseQuery(\"\") returned error: %s", err)
+	}
+	task := MakeTask("anything at all")
+	if !q.Matches(&task) {
+		t.Errorf("an empty query should match every task")
+	}
+}
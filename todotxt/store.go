@@ -0,0 +1,100 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"path/filepath"
+
+	"code.google.com/p/go.exp/fsnotify"
+)
+
+// An Event is sent on a Store's Watch channel when the store's
+// underlying data has changed outside of a call to Save, and callers
+// should Load again to pick up the change.
+type Event struct{}
+
+// A Store loads and saves a TaskList and reports external changes to
+// it.  The three implementations are FileStore, for a local todo.txt
+// file; HTTPStore, for one served over plain HTTP(S); and
+// CalDAVStore, for one synced as VTODO components on a CalDAV/WebDAV
+// collection.
+type Store interface {
+	// Load reads and returns the current TaskList.
+	Load() (*TaskList, error)
+
+	// Save writes the given TaskList, replacing whatever the store
+	// previously held.
+	Save(*TaskList) error
+
+	// Watch returns a channel on which an Event is sent every time
+	// the store detects that its data changed outside of Save.  The
+	// channel is never closed.  A Store that cannot detect external
+	// changes may return a channel that is never sent on.
+	Watch() <-chan Event
+}
+
+// A FileStore is a Store backed by a local todo.txt file.  It uses
+// fsnotify to detect edits made by other programs (e.g. a text editor
+// or another instance of this one) and reports them on its Watch
+// channel.  The watcher does not tell those edits apart from the ones
+// made by the FileStore's own Save, so every Save is reported on the
+// Watch channel as well.
+type FileStore struct {
+	path    string
+	watcher *fsnotify.Watcher
+	events  chan Event
+}
+
+// NewFileStore returns a FileStore for the todo.txt file at path and
+// starts watching it for external changes.
+func NewFileStore(path string) (*FileStore, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the containing directory rather than the file itself so
+	// that editors which replace the file (write to a temp name and
+	// rename over it, as WriteToFile itself does) are still noticed.
+	if err := w.Watch(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	fs := &FileStore{
+		path:    path,
+		watcher: w,
+		events:  make(chan Event, 1),
+	}
+	go fs.loop()
+	return fs, nil
+}
+
+func (fs *FileStore) loop() {
+	want := filepath.Clean(fs.path)
+	for ev := range fs.watcher.Event {
+		if filepath.Clean(ev.Name) != want {
+			continue
+		}
+		select {
+		case fs.events <- Event{}:
+		default:
+		}
+	}
+}
+
+// Load reads and parses the store's todo.txt file.
+func (fs *FileStore) Load() (*TaskList, error) {
+	return LoadFromFile(fs.path)
+}
+
+// Save writes l to the store's todo.txt file, atomically replacing
+// its previous contents.
+func (fs *FileStore) Save(l *TaskList) error {
+	return l.WriteToFile(fs.path)
+}
+
+// Watch returns the channel on which external file changes are
+// reported.
+func (fs *FileStore) Watch() <-chan Event {
+	return fs.events
+}
@@ -0,0 +1,372 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A SortFlag selects one or more keys used to order a TaskList.  Flags
+// are combined with bitwise or.  The keys are compared in a fixed
+// order regardless of how the flags are combined: completion status,
+// then overdue/due-today status, then priority, then creation date,
+// then id; e.g. SortCompletedLast|SortPriorityAsc sorts all
+// incomplete tasks before completed ones, breaking ties by priority.
+type SortFlag uint
+
+const (
+	// SortPriorityAsc orders tasks with no priority last and 'A'
+	// before 'Z'.
+	SortPriorityAsc SortFlag = 1 << iota
+
+	// SortPriorityDesc orders tasks with no priority first and 'Z'
+	// before 'A'.
+	SortPriorityDesc
+
+	// SortCreatedDateAsc orders tasks with no creation date last and
+	// earlier dates before later ones.
+	SortCreatedDateAsc
+
+	// SortCreatedDateDesc orders tasks with no creation date first
+	// and later dates before earlier ones.
+	SortCreatedDateDesc
+
+	// SortCompletedFirst orders done tasks before not-done tasks.
+	SortCompletedFirst
+
+	// SortCompletedLast orders not-done tasks before done tasks.
+	SortCompletedLast
+
+	// SortOverdueFirst pins tasks whose due: date has passed to the
+	// top of the list, followed by tasks due today.
+	SortOverdueFirst
+)
+
+// A TaskList is an ordered, mutable collection of Tasks.  Every task
+// added to a TaskList is given a stable id, unique within that list,
+// that survives re-sorting and filtering so that UI code can refer to
+// a task without tracking its position.
+type TaskList struct {
+	mu     sync.Mutex
+	tasks  []*Task
+	nextID int
+	subs   []chan struct{}
+}
+
+// NewTaskList returns a new, empty TaskList.
+func NewTaskList() *TaskList {
+	return &TaskList{nextID: 1}
+}
+
+// Tasks returns the tasks currently in the list, in list order.  The
+// returned slice is a copy; mutating it does not affect the list, but
+// the *Task values it holds are shared with the list.
+func (l *TaskList) Tasks() []*Task {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ts := make([]*Task, len(l.tasks))
+	copy(ts, l.tasks)
+	return ts
+}
+
+// Len returns the number of tasks in the list.
+func (l *TaskList) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.tasks)
+}
+
+// Add appends t to the list, assigns it a fresh id and returns that
+// id.
+func (l *TaskList) Add(t *Task) int {
+	l.mu.Lock()
+	id := l.nextID
+	l.nextID++
+	t.id = id
+	l.tasks = append(l.tasks, t)
+	l.mu.Unlock()
+	l.notify()
+	return id
+}
+
+// AddWithID appends t to the list under the given id instead of
+// assigning a fresh one, advancing the list's id sequence past id if
+// necessary.  It is meant for restoring a task that was previously
+// removed from the list (e.g. by Undo) to its original id, so that
+// other recorded references to that id remain valid.
+func (l *TaskList) AddWithID(t *Task, id int) {
+	l.mu.Lock()
+	t.id = id
+	l.tasks = append(l.tasks, t)
+	if id >= l.nextID {
+		l.nextID = id + 1
+	}
+	l.mu.Unlock()
+	l.notify()
+}
+
+// Remove deletes the task with the given id from the list.  It
+// returns false if no task with that id is present.
+func (l *TaskList) Remove(id int) bool {
+	l.mu.Lock()
+	removed := false
+	for i, t := range l.tasks {
+		if t.id == id {
+			l.tasks = append(l.tasks[:i], l.tasks[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	l.mu.Unlock()
+	if removed {
+		l.notify()
+	}
+	return removed
+}
+
+// GetTask returns the task with the given id and true, or nil and
+// false if no such task is present.
+func (l *TaskList) GetTask(id int) (*Task, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, t := range l.tasks {
+		if t.id == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Complete marks the task with the given id done.  If the task
+// recurs, its next occurrence is appended to the list with a fresh
+// id and returned as next.  It returns ok false if no task with that
+// id is present.
+func (l *TaskList) Complete(id int) (t, next *Task, ok bool) {
+	t, ok = l.GetTask(id)
+	if !ok {
+		return nil, nil, false
+	}
+	next = t.Complete()
+	if next != nil {
+		l.Add(next)
+	} else {
+		l.notify()
+	}
+	return t, next, true
+}
+
+// Touch notifies subscribers that a task obtained via GetTask was
+// mutated in place, without otherwise changing the list's membership.
+func (l *TaskList) Touch() {
+	l.notify()
+}
+
+// Filter returns a new TaskList containing the tasks for which pred
+// returns true, in their original order.  The returned list shares
+// its *Task values with l, so mutating a task in the filtered list
+// also mutates it in l, but the filtered list has its own identity:
+// adding or removing tasks from it does not affect l.
+func (l *TaskList) Filter(pred func(*Task) bool) *TaskList {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := NewTaskList()
+	for _, t := range l.tasks {
+		if pred(t) {
+			out.tasks = append(out.tasks, t)
+		}
+	}
+	return out
+}
+
+// Sort orders the list's tasks in place according to flag.
+func (l *TaskList) Sort(flag SortFlag) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sort.SliceStable(l.tasks, func(i, j int) bool {
+		return taskLess(l.tasks[i], l.tasks[j], flag, now)
+	})
+}
+
+// TaskLess reports whether task a should sort before task b under
+// flag, treating now as the current time for overdue comparisons.
+func taskLess(a, b *Task, flag SortFlag, now time.Time) bool {
+	if flag&SortCompletedFirst != 0 && a.Done != b.Done {
+		return a.Done
+	}
+	if flag&SortCompletedLast != 0 && a.Done != b.Done {
+		return !a.Done
+	}
+	if flag&SortOverdueFirst != 0 {
+		ao, bo := a.IsOverdue(now), b.IsOverdue(now)
+		if ao != bo {
+			return ao
+		}
+		ad, bd := a.IsDueToday(now), b.IsDueToday(now)
+		if ad != bd {
+			return ad
+		}
+	}
+	if flag&(SortPriorityAsc|SortPriorityDesc) != 0 && a.Priority != b.Priority {
+		ap, bp := priorityRank(a.Priority), priorityRank(b.Priority)
+		if flag&SortPriorityDesc != 0 {
+			return ap > bp
+		}
+		return ap < bp
+	}
+	if flag&(SortCreatedDateAsc|SortCreatedDateDesc) != 0 {
+		switch {
+		case a.CreationDate == nil && b.CreationDate == nil:
+		case a.CreationDate == nil:
+			return flag&SortCreatedDateDesc != 0
+		case b.CreationDate == nil:
+			return flag&SortCreatedDateDesc == 0
+		case !a.CreationDate.Equal(*b.CreationDate):
+			if flag&SortCreatedDateDesc != 0 {
+				return a.CreationDate.After(*b.CreationDate)
+			}
+			return a.CreationDate.Before(*b.CreationDate)
+		}
+	}
+	return a.id < b.id
+}
+
+// PriorityRank returns a value suitable for ordering priorities, with
+// no priority ranked after 'Z'.
+func priorityRank(p rune) int {
+	if p == 0 {
+		return len(PriorityRunes) + 1
+	}
+	return int(p - 'A')
+}
+
+// LoadFromFile reads and parses the todo.txt file at path into a new
+// TaskList, assigning each task a stable id in file order.
+func LoadFromFile(path string) (*TaskList, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	f, err := ReadFile(in)
+	if err != nil {
+		return nil, err
+	}
+	l := NewTaskList()
+	for i := range f.Tasks {
+		l.Add(&f.Tasks[i])
+	}
+	return l, nil
+}
+
+// WriteToFile writes the list to path, replacing any existing file
+// atomically: the list is written to a temporary file in the same
+// directory and then renamed over path.
+func (l *TaskList) WriteToFile(path string) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+
+	f := File{Tasks: l.taskValues()}
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// TaskValues returns a copy of the list's tasks as values, suitable
+// for handing to File.WriteTo.
+func (l *TaskList) taskValues() []Task {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ts := make([]Task, len(l.tasks))
+	for i, t := range l.tasks {
+		ts[i] = *t
+	}
+	return ts
+}
+
+// ArchiveTo moves every completed task out of l and appends it to
+// done, preserving each task's id.
+func (l *TaskList) ArchiveTo(done *TaskList) {
+	l.mu.Lock()
+	var kept, archived []*Task
+	for _, t := range l.tasks {
+		if t.Done {
+			archived = append(archived, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	l.tasks = kept
+	l.mu.Unlock()
+
+	if len(archived) == 0 {
+		return
+	}
+	done.mu.Lock()
+	done.tasks = append(done.tasks, archived...)
+	done.mu.Unlock()
+
+	l.notify()
+	done.notify()
+}
+
+// ReplaceAll replaces l's tasks with other's tasks, in place, so that
+// anything already subscribed to l (see Subscribe) is notified of the
+// reload rather than having to re-subscribe to a new list.
+func (l *TaskList) ReplaceAll(other *TaskList) {
+	other.mu.Lock()
+	tasks := other.tasks
+	next := other.nextID
+	other.mu.Unlock()
+
+	l.mu.Lock()
+	l.tasks = tasks
+	if next > l.nextID {
+		l.nextID = next
+	}
+	l.mu.Unlock()
+	l.notify()
+}
+
+// Subscribe returns a channel that receives a value every time the
+// list's contents change via Add, AddWithID, Remove, Complete, Touch,
+// ArchiveTo or ReplaceAll.  The channel is buffered by one; a
+// notification sent while another is still pending in the buffer is
+// dropped rather than blocking the mutation.
+func (l *TaskList) Subscribe() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	l.subs = append(l.subs, ch)
+	return ch
+}
+
+// Notify wakes every subscriber registered with Subscribe.
+func (l *TaskList) notify() {
+	l.mu.Lock()
+	subs := l.subs
+	l.mu.Unlock()
+	for _, ch := range subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
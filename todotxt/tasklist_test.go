@@ -0,0 +1,196 @@
+// © 2012 Ethan Burns under the MIT license.
+
+package todotxt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTaskListCompleteRecurring(t *testing.T) {
+	l := NewTaskList()
+	task := MakeTask("Pay rent due:2014-01-01 rec:+1m")
+	id := l.Add(&task)
+
+	done, next, ok := l.Complete(id)
+	if !ok {
+		t.Fatalf("Complete(%d) returned false", id)
+	}
+	if !done.Done {
+		t.Errorf("completed task should be marked Done")
+	}
+	if next == nil {
+		t.Errorf("expected a non-nil follow-up task")
+	}
+	if l.Len() != 2 {
+		t.Fatalf("expected the recurrence to add a new task, list has %d tasks", l.Len())
+	}
+
+	if due, ok := next.DueDate(); !ok || due.Format(DateFormat) != "2014-02-01" {
+		t.Errorf("expected next occurrence due 2014-02-01, got %v (ok=%t)", due, ok)
+	}
+}
+
+func TestTaskListCompleteNonRecurring(t *testing.T) {
+	l := NewTaskList()
+	task := MakeTask("Call Mom")
+	id := l.Add(&task)
+
+	if _, _, ok := l.Complete(id); !ok {
+		t.Fatalf("Complete(%d) returned false", id)
+	}
+	if l.Len() != 1 {
+		t.Errorf("completing a non-recurring task should not grow the list, got %d tasks", l.Len())
+	}
+}
+
+func TestTaskListSortOverdueFirst(t *testing.T) {
+	l := NewTaskList()
+	overdue := MakeTask("Overdue due:2000-01-01")
+	future := MakeTask("Future due:2999-01-01")
+	l.Add(&future)
+	l.Add(&overdue)
+
+	l.Sort(SortOverdueFirst)
+	tasks := l.Tasks()
+	if tasks[0].Description != "Overdue" {
+		t.Errorf("expected the overdue task first, got %q", tasks[0].Description)
+	}
+}
+
+func TestTaskListAddWithID(t *testing.T) {
+	l := NewTaskList()
+	first := MakeTask("Call Mom")
+	l.Add(&first)
+
+	removed := MakeTask("Pay rent")
+	removedID := l.Add(&removed)
+	l.Remove(removedID)
+
+	restored := MakeTask("Pay rent")
+	l.AddWithID(&restored, removedID)
+	if got, ok := l.GetTask(removedID); !ok || got != &restored {
+		t.Fatalf("AddWithID(%d) did not restore the task under its original id", removedID)
+	}
+
+	next := MakeTask("Buy milk")
+	newID := l.Add(&next)
+	if newID <= removedID {
+		t.Errorf("expected a fresh id greater than the restored id %d, got %d", removedID, newID)
+	}
+}
+
+func TestTaskListFilter(t *testing.T) {
+	l := NewTaskList()
+	novel := MakeTask("Write chapter one +Novel")
+	chores := MakeTask("Do dishes")
+	l.Add(&novel)
+	l.Add(&chores)
+
+	filtered := l.Filter(func(t *Task) bool {
+		for _, p := range t.Projects {
+			if p == "+Novel" {
+				return true
+			}
+		}
+		return false
+	})
+	tasks := filtered.Tasks()
+	if len(tasks) != 1 || tasks[0].Description != "Write chapter one" {
+		t.Fatalf("expected only the +Novel task, got %v", tasks)
+	}
+
+	// The filtered list shares tasks with l, but has its own identity:
+	// removing from it must not affect l.
+	filtered.Remove(tasks[0].ID())
+	if l.Len() != 2 {
+		t.Errorf("removing from a filtered list should not affect the source list, got %d tasks", l.Len())
+	}
+}
+
+func TestTaskListLoadAndWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todotxt")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "todo.txt")
+
+	l := NewTaskList()
+	first := MakeTask("Call Mom")
+	second := MakeTask("(A) Pay rent due:2014-01-01")
+	l.Add(&first)
+	l.Add(&second)
+
+	if err := l.WriteToFile(path); err != nil {
+		t.Fatalf("WriteToFile: %s", err)
+	}
+	if entries, err := ioutil.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Fatalf("expected WriteToFile's temp file to be renamed away, found %v (err=%v)", entries, err)
+	}
+
+	loaded, err := LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %s", err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("expected 2 tasks, got %d", loaded.Len())
+	}
+	tasks := loaded.Tasks()
+	if tasks[0].String() != first.String() || tasks[1].String() != second.String() {
+		t.Errorf("round-tripped tasks don't match: got %q, %q", tasks[0].String(), tasks[1].String())
+	}
+}
+
+func TestTaskListArchiveTo(t *testing.T) {
+	l := NewTaskList()
+	open := MakeTask("Call Mom")
+	done := MakeTask("x 2014-01-01 Pay rent")
+	l.Add(&open)
+	l.Add(&done)
+
+	archive := NewTaskList()
+	l.ArchiveTo(archive)
+
+	if l.Len() != 1 || l.Tasks()[0].Description != "Call Mom" {
+		t.Errorf("expected only the open task to remain, got %v", l.Tasks())
+	}
+	if archive.Len() != 1 || archive.Tasks()[0].Description != "Pay rent" {
+		t.Errorf("expected the done task to be archived, got %v", archive.Tasks())
+	}
+}
+
+func TestTaskListSubscribe(t *testing.T) {
+	l := NewTaskList()
+	ch := l.Subscribe()
+
+	task := MakeTask("Call Mom")
+	l.Add(&task)
+
+	select {
+	case <-ch:
+	default:
+		t.Fatalf("expected a notification after Add")
+	}
+}
+
+func TestTaskListRemoveAndGetTask(t *testing.T) {
+	l := NewTaskList()
+	task := MakeTask("Call Mom")
+	id := l.Add(&task)
+
+	if _, ok := l.GetTask(id); !ok {
+		t.Fatalf("GetTask(%d) should find the task", id)
+	}
+	if !l.Remove(id) {
+		t.Fatalf("Remove(%d) should succeed", id)
+	}
+	if _, ok := l.GetTask(id); ok {
+		t.Errorf("GetTask(%d) should fail after removal", id)
+	}
+	if l.Remove(id) {
+		t.Errorf("Remove(%d) should fail the second time", id)
+	}
+}
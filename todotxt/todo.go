@@ -7,6 +7,8 @@ package todotxt
 import (
 	"bufio"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
@@ -28,6 +30,17 @@ const (
 
 	// DateFormat is the format string for dates.
 	DateFormat = "2006-01-02"
+
+	// DueKeyword is the keyword whose value is a task's due date.
+	DueKeyword = "due"
+
+	// ThresholdKeyword is the keyword whose value is a task's
+	// threshold (hide-until) date.
+	ThresholdKeyword = "t"
+
+	// RecurKeyword is the keyword whose value describes how a task
+	// recurs after it is completed.
+	RecurKeyword = "rec"
 )
 
 // File is a todo.txt file.
@@ -47,7 +60,9 @@ func ReadFile(in io.Reader) (File, error) {
 		}
 
 		line = strings.TrimRight(line, "\r\n")
-		f.Tasks = append(f.Tasks, MakeTask(line))
+		if line != "" || err != io.EOF {
+			f.Tasks = append(f.Tasks, MakeTask(line))
+		}
 
 		if err == io.EOF {
 			break
@@ -70,33 +85,105 @@ func (f *File) WriteTo(out io.Writer) (int64, error) {
 	return tot, nil
 }
 
-// A Task is a single line of a todo.txt file.
+// A Task is a single line of a todo.txt file, parsed into its
+// component fields.  Unlike the raw todo.txt text, a Task can be
+// mutated in place: its setters keep every field consistent so that
+// String always reconstructs valid todo.txt syntax.
 type Task struct {
-	text                 string
-	fields               []string
-	done                 bool
-	prio                 rune
-	createDate, doneDate time.Time
+	// id is a stable identifier assigned by a TaskList when the task
+	// is added to it.  A task not owned by a TaskList has id 0.
+	id int
+
+	// Done is true if the task is marked complete.
+	Done bool
+
+	// Priority is the task's priority rune, 'A' through 'Z', or the
+	// zero rune if the task has no priority.
+	Priority rune
+
+	// CompletionDate is the date the task was completed, or nil if
+	// the task is not done or was done without a recorded date.
+	CompletionDate *time.Time
+
+	// CreationDate is the date the task was created, or nil if the
+	// task has no recorded creation date.
+	CreationDate *time.Time
+
+	// Description is the free-text portion of the task, excluding
+	// its projects, contexts and keyword tags.
+	Description string
+
+	// Projects is the list of +project tags on the task, in the
+	// order they appear.
+	Projects []string
+
+	// Contexts is the list of @context tags on the task, in the
+	// order they appear.
+	Contexts []string
+
+	// Tags is the set of key:value keyword bindings on the task,
+	// e.g. due:2014-02-01 or rec:+1m.
+	Tags map[string]string
 }
 
-// MakeTask returns a task for the given text.  If the text contains
-// newlines then they are interpreted as space characters (' ').
+// MakeTask parses the given todo.txt line into a Task.  If the text
+// contains newlines then they are interpreted as space characters (' ').
 func MakeTask(text string) Task {
 	text = strings.Replace(text, "\r\n", " ", -1)
 	text = strings.Replace(text, "\n", " ", -1)
 
-	t := Task{text: text, fields: strings.Fields(text)}
+	var t Task
+	t.Tags = make(map[string]string)
+
+	t.Done, text = parseDone(text)
+	if t.Done {
+		var d time.Time
+		d, text = parseDate(text)
+		if !d.IsZero() {
+			t.CompletionDate = &d
+		}
+	}
+	t.Priority, text = parsePriority(text)
+	if d, rest := parseDate(text); !d.IsZero() {
+		t.CreationDate = &d
+		text = rest
+	}
 
-	t.done, text = parseDone(text)
-	if t.done {
-		t.doneDate, text = parseDate(text)
+	var words []string
+	for _, f := range strings.Fields(text) {
+		switch {
+		case isTag(f, ProjectTag):
+			t.Projects = append(t.Projects, f)
+		case isTag(f, ContextTag):
+			t.Contexts = append(t.Contexts, f)
+		default:
+			if i := strings.IndexRune(f, KeywordSep); i > 0 {
+				t.Tags[f[:i]] = f[i+1:]
+				continue
+			}
+			words = append(words, f)
+		}
 	}
-	t.prio, text = parsePriority(text)
-	t.createDate, _ = parseDate(text)
+	t.Description = strings.Join(words, " ")
 
 	return t
 }
 
+// IsTag returns true if the field is a tag beginning with the given
+// marker rune and ending in an alphanumeric or '_' rune.
+func isTag(f string, marker rune) bool {
+	if first, _ := utf8.DecodeRuneInString(f); first != marker {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(f)
+	return tagEnd(last)
+}
+
+// TagEnd returns true for runes that are valid tag ends.
+func tagEnd(r rune) bool {
+	return unicode.IsDigit(r) || unicode.IsLetter(r) || r == '_'
+}
+
 // ParseDone returns the completed status from the string and the
 // rest of the string after it.
 func parseDone(s string) (bool, string) {
@@ -139,82 +226,263 @@ func parsePriority(s string) (rune, string) {
 	return prio, s
 }
 
-// String returns the single-line string representation of this task.
+// String returns the canonical single-line todo.txt representation of
+// this task, reconstructed from its fields.
 func (t *Task) String() string {
-	return t.text
+	var parts []string
+	if t.Done {
+		parts = append(parts, "x")
+		if t.CompletionDate != nil {
+			parts = append(parts, t.CompletionDate.Format(DateFormat))
+		}
+	}
+	if t.Priority != 0 {
+		parts = append(parts, "("+string(t.Priority)+")")
+	}
+	if t.CreationDate != nil {
+		parts = append(parts, t.CreationDate.Format(DateFormat))
+	}
+	if t.Description != "" {
+		parts = append(parts, t.Description)
+	}
+	parts = append(parts, t.Projects...)
+	parts = append(parts, t.Contexts...)
+
+	keys := make([]string, 0, len(t.Tags))
+	for k := range t.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, k+string(KeywordSep)+t.Tags[k])
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// IsDone returns true if this task is completed.
+func (t *Task) IsDone() bool {
+	return t.Done
+}
+
+// ID returns the task's stable identifier within the TaskList that
+// owns it, or 0 if the task does not belong to a TaskList.
+func (t *Task) ID() int {
+	return t.id
+}
+
+// SetPriority sets the task's priority to p, which must be a rune in
+// PriorityRunes, or the zero rune to clear the priority.
+func (t *Task) SetPriority(p rune) {
+	t.Priority = p
 }
 
-// Priority returns the task's priority value rune or the zero rune if
-// the task does not have a priority.
-func (t *Task) Priority() rune {
-	return t.prio
+// DueDate returns the task's due date and true if it has one and it
+// parses as a valid date.
+func (t *Task) DueDate() (time.Time, bool) {
+	return t.dateTag(DueKeyword)
 }
 
-// Complete marks the task as complete.
-func (t *Task) Complete() {
-	if t.IsDone() {
-		return
+// SetDueDate sets the task's due: keyword to the given date.
+func (t *Task) SetDueDate(d time.Time) {
+	t.Tags[DueKeyword] = d.Format(DateFormat)
+}
+
+// ThresholdDate returns the task's t: (threshold) date and true if it
+// has one and it parses as a valid date.
+func (t *Task) ThresholdDate() (time.Time, bool) {
+	return t.dateTag(ThresholdKeyword)
+}
+
+// SetThresholdDate sets the task's t: keyword to the given date.
+func (t *Task) SetThresholdDate(d time.Time) {
+	t.Tags[ThresholdKeyword] = d.Format(DateFormat)
+}
+
+// DateTag returns the parsed date stored under the given keyword.
+func (t *Task) dateTag(keyword string) (time.Time, bool) {
+	v, ok := t.Tags[keyword]
+	if !ok {
+		return time.Time{}, false
 	}
-	fmt := DateFormat
-	if t.text != "" {
-		fmt += " "
+	d, err := time.Parse(DateFormat, v)
+	if err != nil {
+		return time.Time{}, false
 	}
-	prefix := "x " + time.Now().Format(fmt)
-	*t = MakeTask(prefix + t.text)
+	return d, true
 }
 
-// IsDone returns true if this task is completed.
-func (t *Task) IsDone() bool {
-	return t.done
+// SetText reparses text into t's fields, preserving t's id.  It is
+// the primitive used to apply a whole-line edit to a task already
+// owned by a TaskList, e.g. to undo or redo a prior change.
+func (t *Task) SetText(text string) {
+	id := t.id
+	*t = MakeTask(text)
+	t.id = id
 }
 
-// CompletionDate returns the completion date if this task is done and
-// included such a date.  Otherwise, the zero time is returned.
-func (t *Task) CompletionDate() time.Time {
-	return t.doneDate
+// Reopen clears a task's done and completion-date status, undoing a
+// prior call to Complete.
+func (t *Task) Reopen() {
+	t.Done = false
+	t.CompletionDate = nil
 }
 
-// CreationDate returns the creation date if specified.  Otherwise, the
-// zero time is returned.
-func (t *Task) CreationDate() time.Time {
-	return t.createDate
+// Complete marks the task as done, stamping it with today's
+// completion date.  If the task has a rec: recurrence tag, Complete
+// also returns a new follow-up Task with its due (and threshold) date
+// advanced as described by NextOccurrence; otherwise it returns nil.
+// Completing a task that is already done changes nothing and returns
+// nil.
+func (t *Task) Complete() *Task {
+	if t.Done {
+		return nil
+	}
+	now := time.Now()
+	d := truncateToDay(now)
+	t.Done = true
+	t.CompletionDate = &d
+
+	next, ok := t.NextOccurrence(now)
+	if !ok {
+		return nil
+	}
+	return next
 }
 
-// Tags returns all tag with the given marker rune.
-// A tag is a white-space delienated field that begins with a marker
-// rune and ends with an alphanumeric or '_' rune.
-// Projects are tags that begin with '+'.
-// Contexts are tags that begin with '@'.
-func (t *Task) Tags(marker rune) []string {
-	var tags []string
-	for _, f := range t.fields {
-		if first, _ := utf8.DecodeRuneInString(f); first != marker {
-			continue
+// NextOccurrence returns the follow-up task produced by recurring
+// this task's rec: value, and true.  The new due date is counted from
+// now's day, or from the task's due date if the rec: value starts
+// with '+' and the task has one.  A t: threshold date keeps its
+// distance before the due date.  It returns nil, false if the task has
+// no rec: tag or the tag's value is malformed.
+func (t *Task) NextOccurrence(now time.Time) (*Task, bool) {
+	rec, ok := t.Tags[RecurKeyword]
+	if !ok {
+		return nil, false
+	}
+
+	fromOrig, n, unit, err := parseRecurrence(rec)
+	if err != nil {
+		return nil, false
+	}
+
+	from := truncateToDay(now)
+	if fromOrig {
+		if due, ok := t.DueDate(); ok {
+			from = due
 		}
-		if last, _ := utf8.DecodeLastRuneInString(f); !tagEnd(last) {
-			continue
+	}
+	next := advanceDate(from, n, unit)
+
+	clone := *t
+	clone.id = 0
+	clone.Done = false
+	clone.CompletionDate = nil
+	clone.Tags = make(map[string]string, len(t.Tags))
+	for k, v := range t.Tags {
+		clone.Tags[k] = v
+	}
+	clone.Tags[DueKeyword] = next.Format(DateFormat)
+	if thresh, ok := t.ThresholdDate(); ok {
+		base, ok := t.DueDate()
+		if !ok {
+			base, _ = time.Parse(DateFormat, from.Format(DateFormat))
 		}
-		tags = append(tags, f)
+		days := int(base.Sub(thresh).Hours() / 24)
+		clone.SetThresholdDate(next.AddDate(0, 0, -days))
 	}
-	return tags
+	return &clone, true
 }
 
-// TagEnd returns true for runes that are valid tag ends.
-func tagEnd(r rune) bool {
-	return unicode.IsDigit(r) || unicode.IsLetter(r) || r == '_'
+// IsOverdue returns true if the task has a due: date before now and
+// is not yet done.
+func (t *Task) IsOverdue(now time.Time) bool {
+	if t.Done {
+		return false
+	}
+	due, ok := t.DueDate()
+	if !ok {
+		return false
+	}
+	today, _ := time.Parse(DateFormat, now.Format(DateFormat))
+	return due.Before(today)
 }
 
-// Keywords returns a mapping of <keyword>:<value> pairs in this task.
-// If there are multiple assignments to the same keyword then only the
-// last one is returned.
-func (t *Task) Keywords() map[string]string {
-	kwds := make(map[string]string)
-	for _, f := range t.fields {
-		i := strings.IndexRune(f, KeywordSep)
-		if i < 0 {
-			continue
+// IsDueToday returns true if the task has a due: date of now's day
+// and is not yet done.
+func (t *Task) IsDueToday(now time.Time) bool {
+	if t.Done {
+		return false
+	}
+	due, ok := t.DueDate()
+	if !ok {
+		return false
+	}
+	today, _ := time.Parse(DateFormat, now.Format(DateFormat))
+	return due.Equal(today)
+}
+
+// ParseRecurrence parses a rec: value of the form "[+]<n><unit>",
+// e.g. "1d", "2w", "+3m".  A leading '+' means the recurrence is
+// measured from the task's due date rather than from today.
+func parseRecurrence(s string) (fromOrig bool, n int, unit byte, err error) {
+	if strings.HasPrefix(s, "+") {
+		fromOrig = true
+		s = s[1:]
+	}
+	if len(s) < 2 {
+		return false, 0, 0, recurrenceError(s)
+	}
+	unit = s[len(s)-1]
+	switch unit {
+	case 'd', 'w', 'm', 'y', 'b':
+	default:
+		return false, 0, 0, recurrenceError(s)
+	}
+	n, perr := strconv.Atoi(s[:len(s)-1])
+	if perr != nil || n <= 0 {
+		return false, 0, 0, recurrenceError(s)
+	}
+	return fromOrig, n, unit, nil
+}
+
+// AdvanceDate advances base by n units, where unit is one of
+// 'd' (days), 'w' (weeks), 'm' (months), 'y' (years) or
+// 'b' (business days, skipping Saturday and Sunday).
+func advanceDate(base time.Time, n int, unit byte) time.Time {
+	switch unit {
+	case 'd':
+		return base.AddDate(0, 0, n)
+	case 'w':
+		return base.AddDate(0, 0, 7*n)
+	case 'm':
+		return base.AddDate(0, n, 0)
+	case 'y':
+		return base.AddDate(n, 0, 0)
+	case 'b':
+		d := base
+		for ; n > 0; n-- {
+			d = d.AddDate(0, 0, 1)
+			for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+				d = d.AddDate(0, 0, 1)
+			}
 		}
-		kwds[f[:i]] = f[i+1:]
+		return d
 	}
-	return kwds
+	return base
+}
+
+// TruncateToDay zeroes the time-of-day portion of t, keeping its date
+// and location.
+func truncateToDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
 }
+
+type recurrenceError string
+
+func (e recurrenceError) Error() string {
+	return "invalid recurrence value: " + string(e)
+}
+
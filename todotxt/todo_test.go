@@ -4,7 +4,6 @@ package todotxt
 
 import (
 	"reflect"
-	"sort"
 	"testing"
 	"time"
 )
@@ -30,45 +29,55 @@ func TestMakeTask(t *testing.T) {
 	}
 	for _, test := range tests {
 		task := MakeTask(test.text)
-		if task.done != test.done {
-			t.Errorf("Text [%s] expected done %t, got %t", test.text, test.done, task.done)
+		if task.Done != test.done {
+			t.Errorf("Text [%s] expected done %t, got %t", test.text, test.done, task.Done)
 		}
-		if task.prio != test.prio {
-			t.Errorf("Text [%s] expected prio %s, got %s", test.text, test.prio, task.prio)
+		if task.Priority != test.prio {
+			t.Errorf("Text [%s] expected prio %s, got %s", test.text, string(test.prio), string(task.Priority))
 		}
-		if !task.doneDate.Equal(test.doneDate) {
-			t.Errorf("Text [%s] expected doneDate %s, got %s", test.text, test.doneDate, task.doneDate)
+		if got := taskTime(task.CompletionDate); !got.Equal(test.doneDate) {
+			t.Errorf("Text [%s] expected doneDate %s, got %s", test.text, test.doneDate, got)
 		}
-		if !task.createDate.Equal(test.createDate) {
-			t.Errorf("Text [%s] expected createDate %s, got %s", test.text, test.createDate, task.createDate)
+		if got := taskTime(task.CreationDate); !got.Equal(test.createDate) {
+			t.Errorf("Text [%s] expected createDate %s, got %s", test.text, test.createDate, got)
 		}
 	}
 }
 
+// TaskTime returns the zero time for a nil date pointer, or the
+// pointed-to time otherwise.
+func taskTime(d *time.Time) time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	return *d
+}
+
 func d(year int, month time.Month, day int) time.Time {
 	return time.Date(year, month, day, 0, 0, 0, 0, time.FixedZone("UTC", 0))
 }
 
-func TestTags(t *testing.T) {
+func TestProjectsAndContexts(t *testing.T) {
 	tests := []struct {
-		text   string
-		marker rune
-		tags   []string
+		text     string
+		projects []string
+		contexts []string
 	}{
-		{"", '+', nil},
-		{"+foo +bar", '+', []string{"+foo", "+bar"}},
-		{"@foo @bar", '@', []string{"@foo", "@bar"}},
-		{"hello +foo there +bar", '+', []string{"+foo", "+bar"}},
-		{"hello @foo there @bar", '@', []string{"@foo", "@bar"}},
-		{"+foo+ +bar", '+', []string{"+bar"}},
+		{"", nil, nil},
+		{"+foo +bar", []string{"+foo", "+bar"}, nil},
+		{"@foo @bar", nil, []string{"@foo", "@bar"}},
+		{"hello +foo there +bar", []string{"+foo", "+bar"}, nil},
+		{"hello @foo there @bar", nil, []string{"@foo", "@bar"}},
+		{"+foo+ +bar", []string{"+bar"}, nil},
+		{"Call Mom +Family @Phone", []string{"+Family"}, []string{"@Phone"}},
 	}
 	for _, test := range tests {
 		task := MakeTask(test.text)
-		tags := task.Tags(test.marker)
-		sort.Strings(tags)
-		sort.Strings(test.tags)
-		if !reflect.DeepEqual(tags, test.tags) {
-			t.Errorf("Text [%s], marker %c expected %v, got %v", test.text, test.marker, test.tags, tags)
+		if !reflect.DeepEqual(task.Projects, test.projects) {
+			t.Errorf("Text [%s] expected projects %v, got %v", test.text, test.projects, task.Projects)
+		}
+		if !reflect.DeepEqual(task.Contexts, test.contexts) {
+			t.Errorf("Text [%s] expected contexts %v, got %v", test.text, test.contexts, task.Contexts)
 		}
 	}
 }
@@ -92,11 +101,10 @@ func TestKeywords(t *testing.T) {
 	}
 	for _, test := range tests {
 		task := MakeTask(test.text)
-		kwds := task.Keywords()
-		if len(kwds) != len(test.kwds) {
-			t.Errorf("Text [%s] expected %d keywords, got %d", test.text, len(test.kwds), len(kwds))
+		if len(task.Tags) != len(test.kwds) {
+			t.Errorf("Text [%s] expected %d keywords, got %d", test.text, len(test.kwds), len(task.Tags))
 		}
-		for key, val := range kwds {
+		for key, val := range task.Tags {
 			if v, ok := test.kwds[key]; !ok {
 				t.Errorf("Text [%s] unexpected keyword %s", test.text, key)
 			} else if v != val {
@@ -106,14 +114,29 @@ func TestKeywords(t *testing.T) {
 	}
 }
 
+func TestString(t *testing.T) {
+	tests := []string{
+		"",
+		"x 2012-12-23 2012-12-20",
+		"x 2012-12-23 (A) 2012-12-20 Call Mom",
+		"(A) Call Mom +Family @Phone due:2012-12-25",
+	}
+	for _, text := range tests {
+		task := MakeTask(text)
+		if got := task.String(); got != text {
+			t.Errorf("String() round-trip: expected [%s], got [%s]", text, got)
+		}
+	}
+}
+
 func TestComplete(t *testing.T) {
 	today := time.Now().Format(DateFormat)
 	tests := []struct {
 		text, doneText string
 	}{
 		{"", "x " + today},
-		{"x ", "x "},
-		{"x", "x " + today + " x"}, // No space after initial x: not initially done.
+		{"x ", "x"},
+		{"x", "x " + today + " x"},
 		{"+foo +bar @baz", "x " + today + " +foo +bar @baz"},
 	}
 	for _, test := range tests {
@@ -125,3 +148,57 @@ func TestComplete(t *testing.T) {
 		}
 	}
 }
+
+func TestCompleteAlreadyDone(t *testing.T) {
+	task := MakeTask("x 2012-12-20 (A) Call Mom")
+	next := task.Complete()
+	if next != nil {
+		t.Errorf("Completing an already-done task should return nil, got %v", next)
+	}
+	if task.String() != "x 2012-12-20 (A) Call Mom" {
+		t.Errorf("Completing an already-done task should not change it, got [%s]", task.String())
+	}
+}
+
+func TestReopen(t *testing.T) {
+	task := MakeTask("Call Mom")
+	task.Complete()
+	task.Reopen()
+	if task.Done {
+		t.Errorf("Reopen should clear Done")
+	}
+	if task.CompletionDate != nil {
+		t.Errorf("Reopen should clear CompletionDate, got %v", task.CompletionDate)
+	}
+}
+
+func TestCompleteRecurring(t *testing.T) {
+	tests := []struct {
+		text       string
+		wantDue    string
+		wantNonNil bool
+	}{
+		{"Pay rent due:2014-01-01 rec:1m", "", true},
+		{"Pay rent due:2014-01-01 rec:+1m", "2014-02-01", true},
+		{"Call Mom", "", false},
+	}
+	for _, test := range tests {
+		task := MakeTask(test.text)
+		next := task.Complete()
+		if (next != nil) != test.wantNonNil {
+			t.Errorf("Text [%s] expected non-nil next occurrence = %t, got %v", test.text, test.wantNonNil, next)
+			continue
+		}
+		if next == nil {
+			continue
+		}
+		if next.Done {
+			t.Errorf("Text [%s] next occurrence should not be done", test.text)
+		}
+		if test.wantDue != "" {
+			if due, ok := next.DueDate(); !ok || due.Format(DateFormat) != test.wantDue {
+				t.Errorf("Text [%s] expected due %s, got %v (ok=%t)", test.text, test.wantDue, due, ok)
+			}
+		}
+	}
+}